@@ -0,0 +1,291 @@
+package tcpint
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNoHealthyUpstream is returned by a Balancer when every upstream in its
+// pool is currently marked unhealthy.
+var ErrNoHealthyUpstream = errors.New("tcpint: no healthy upstream available")
+
+// Balancer selects which upstream a new connection should be dialed to.
+// Implementations must be safe for concurrent use.
+type Balancer interface {
+	// Next returns the upstream address to dial for a new connection.
+	Next() (string, error)
+	// Release is called when a connection to addr ends, so
+	// connection-aware balancers (e.g. least-connections) can update
+	// their bookkeeping.
+	Release(addr string)
+	// SetHealthy marks addr up or down, e.g. from a health check probe.
+	SetHealthy(addr string, healthy bool)
+}
+
+// upstream tracks the health and load of a single pool member.
+type upstream struct {
+	addr    string
+	weight  int
+	healthy int32 // atomic bool, 1 = healthy
+	conns   int64 // atomic, active connection count
+}
+
+func newUpstreamPool(tos []string) []*upstream {
+	pool := make([]*upstream, len(tos))
+	for i, addr := range tos {
+		pool[i] = &upstream{addr: addr, weight: 1, healthy: 1}
+	}
+	return pool
+}
+
+type roundRobinBalancer struct {
+	upstreams []*upstream
+	next      uint64
+}
+
+// NewRoundRobinBalancer cycles through tos in order, skipping upstreams
+// currently marked unhealthy.
+func NewRoundRobinBalancer(tos []string) Balancer {
+	return &roundRobinBalancer{upstreams: newUpstreamPool(tos)}
+}
+
+func (b *roundRobinBalancer) Next() (string, error) {
+	n := len(b.upstreams)
+	start := int(atomic.AddUint64(&b.next, 1))
+	for i := 0; i < n; i++ {
+		u := b.upstreams[(start+i)%n]
+		if atomic.LoadInt32(&u.healthy) == 1 {
+			atomic.AddInt64(&u.conns, 1)
+			return u.addr, nil
+		}
+	}
+	return "", ErrNoHealthyUpstream
+}
+
+func (b *roundRobinBalancer) Release(addr string) {
+	releaseConn(b.upstreams, addr)
+}
+
+func (b *roundRobinBalancer) SetHealthy(addr string, healthy bool) {
+	setHealthy(b.upstreams, addr, healthy)
+}
+
+type randomBalancer struct {
+	upstreams []*upstream
+}
+
+// NewRandomBalancer picks a uniformly random healthy upstream per connection.
+func NewRandomBalancer(tos []string) Balancer {
+	return &randomBalancer{upstreams: newUpstreamPool(tos)}
+}
+
+func (b *randomBalancer) Next() (string, error) {
+	healthy := healthyUpstreams(b.upstreams)
+	if len(healthy) == 0 {
+		return "", ErrNoHealthyUpstream
+	}
+	u := healthy[rand.Intn(len(healthy))]
+	atomic.AddInt64(&u.conns, 1)
+	return u.addr, nil
+}
+
+func (b *randomBalancer) Release(addr string) {
+	releaseConn(b.upstreams, addr)
+}
+
+func (b *randomBalancer) SetHealthy(addr string, healthy bool) {
+	setHealthy(b.upstreams, addr, healthy)
+}
+
+type leastConnBalancer struct {
+	upstreams []*upstream
+}
+
+// NewLeastConnBalancer sends each connection to the healthy upstream with
+// the fewest currently-active connections.
+func NewLeastConnBalancer(tos []string) Balancer {
+	return &leastConnBalancer{upstreams: newUpstreamPool(tos)}
+}
+
+func (b *leastConnBalancer) Next() (string, error) {
+	var best *upstream
+	for _, u := range b.upstreams {
+		if atomic.LoadInt32(&u.healthy) != 1 {
+			continue
+		}
+		if best == nil || atomic.LoadInt64(&u.conns) < atomic.LoadInt64(&best.conns) {
+			best = u
+		}
+	}
+	if best == nil {
+		return "", ErrNoHealthyUpstream
+	}
+	atomic.AddInt64(&best.conns, 1)
+	return best.addr, nil
+}
+
+func (b *leastConnBalancer) Release(addr string) {
+	releaseConn(b.upstreams, addr)
+}
+
+func (b *leastConnBalancer) SetHealthy(addr string, healthy bool) {
+	setHealthy(b.upstreams, addr, healthy)
+}
+
+type weightedBalancer struct {
+	upstreams []*upstream
+	mu        sync.Mutex
+	current   []int
+}
+
+// NewWeightedBalancer distributes connections across tos proportionally to
+// weights (matched by index), using smooth weighted round-robin.
+func NewWeightedBalancer(tos []string, weights []int) Balancer {
+	pool := newUpstreamPool(tos)
+	for i, u := range pool {
+		if i < len(weights) && weights[i] > 0 {
+			u.weight = weights[i]
+		}
+	}
+	return &weightedBalancer{upstreams: pool, current: make([]int, len(pool))}
+}
+
+func (b *weightedBalancer) Next() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var best = -1
+	total := 0
+	for i, u := range b.upstreams {
+		if atomic.LoadInt32(&u.healthy) != 1 {
+			continue
+		}
+		b.current[i] += u.weight
+		total += u.weight
+		if best == -1 || b.current[i] > b.current[best] {
+			best = i
+		}
+	}
+	if best == -1 {
+		return "", ErrNoHealthyUpstream
+	}
+	b.current[best] -= total
+	atomic.AddInt64(&b.upstreams[best].conns, 1)
+	return b.upstreams[best].addr, nil
+}
+
+func (b *weightedBalancer) Release(addr string) {
+	releaseConn(b.upstreams, addr)
+}
+
+func (b *weightedBalancer) SetHealthy(addr string, healthy bool) {
+	setHealthy(b.upstreams, addr, healthy)
+}
+
+type failoverBalancer struct {
+	upstreams []*upstream
+}
+
+// NewFailoverBalancer always prefers tos[0], falling back to the next
+// healthy upstream in order. Combined with health checks this gives an
+// active/passive failover pool.
+func NewFailoverBalancer(tos []string) Balancer {
+	return &failoverBalancer{upstreams: newUpstreamPool(tos)}
+}
+
+func (b *failoverBalancer) Next() (string, error) {
+	for _, u := range b.upstreams {
+		if atomic.LoadInt32(&u.healthy) == 1 {
+			atomic.AddInt64(&u.conns, 1)
+			return u.addr, nil
+		}
+	}
+	return "", ErrNoHealthyUpstream
+}
+
+func (b *failoverBalancer) Release(addr string) {
+	releaseConn(b.upstreams, addr)
+}
+
+func (b *failoverBalancer) SetHealthy(addr string, healthy bool) {
+	setHealthy(b.upstreams, addr, healthy)
+}
+
+func healthyUpstreams(pool []*upstream) []*upstream {
+	healthy := make([]*upstream, 0, len(pool))
+	for _, u := range pool {
+		if atomic.LoadInt32(&u.healthy) == 1 {
+			healthy = append(healthy, u)
+		}
+	}
+	return healthy
+}
+
+func releaseConn(pool []*upstream, addr string) {
+	for _, u := range pool {
+		if u.addr == addr {
+			atomic.AddInt64(&u.conns, -1)
+			return
+		}
+	}
+}
+
+func setHealthy(pool []*upstream, addr string, healthy bool) {
+	for _, u := range pool {
+		if u.addr == addr {
+			v := int32(0)
+			if healthy {
+				v = 1
+			}
+			atomic.StoreInt32(&u.healthy, v)
+			return
+		}
+	}
+}
+
+// HealthCheck probes an upstream and reports whether it is up.
+type HealthCheck func(addr string) bool
+
+// TCPHealthCheck returns a HealthCheck that considers an upstream healthy if
+// a plain TCP connect succeeds within timeout.
+func TCPHealthCheck(timeout time.Duration) HealthCheck {
+	return func(addr string) bool {
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+}
+
+// StartHealthChecks runs check against every upstream known to the proxy's
+// balancer every interval, feeding the result back via Balancer.SetHealthy,
+// until the proxy stops. NewProxyPool calls this automatically with a
+// TCPHealthCheck. Each call starts its own loop: calling it again adds a
+// second probe, and the loop NewProxyPool started keeps running alongside it.
+func (p *Proxy) StartHealthChecks(interval time.Duration, check HealthCheck) {
+	if p.balancer == nil || p.tos == nil {
+		return
+	}
+	done := p.done
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, addr := range p.tos {
+					healthy := check(addr)
+					p.balancer.SetHealthy(addr, healthy)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,124 @@
+package tcpint
+
+import "testing"
+
+func TestRoundRobinBalancerCyclesAndSkipsUnhealthy(t *testing.T) {
+	b := NewRoundRobinBalancer([]string{"a", "b", "c"})
+	b.SetHealthy("b", false)
+
+	seen := map[string]int{}
+	for i := 0; i < 6; i++ {
+		addr, err := b.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		seen[addr]++
+	}
+	if seen["b"] != 0 {
+		t.Errorf("unhealthy upstream b was selected %d times, want 0", seen["b"])
+	}
+	if seen["a"] == 0 || seen["c"] == 0 {
+		t.Errorf("expected both healthy upstreams to be used, got %v", seen)
+	}
+}
+
+func TestRoundRobinBalancerNoHealthyUpstream(t *testing.T) {
+	b := NewRoundRobinBalancer([]string{"a", "b"})
+	b.SetHealthy("a", false)
+	b.SetHealthy("b", false)
+
+	if _, err := b.Next(); err != ErrNoHealthyUpstream {
+		t.Errorf("Next() err = %v, want ErrNoHealthyUpstream", err)
+	}
+}
+
+func TestRandomBalancerOnlyPicksHealthy(t *testing.T) {
+	b := NewRandomBalancer([]string{"a", "b"})
+	b.SetHealthy("a", false)
+
+	for i := 0; i < 10; i++ {
+		addr, err := b.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if addr != "b" {
+			t.Errorf("Next() = %q, want %q", addr, "b")
+		}
+	}
+}
+
+func TestLeastConnBalancerPrefersFewerConns(t *testing.T) {
+	b := NewLeastConnBalancer([]string{"a", "b"})
+
+	addr, err := b.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if addr != "a" {
+		t.Fatalf("first Next() = %q, want %q", addr, "a")
+	}
+	// a now has 1 conn, b has 0, so the next pick should go to b.
+	addr, err = b.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if addr != "b" {
+		t.Fatalf("second Next() = %q, want %q", addr, "b")
+	}
+
+	b.Release("a")
+	// a is back to 0 conns while b still has 1, so the next pick is a again.
+	addr, err = b.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if addr != "a" {
+		t.Errorf("third Next() = %q, want %q", addr, "a")
+	}
+}
+
+func TestWeightedBalancerDistributesByWeight(t *testing.T) {
+	b := NewWeightedBalancer([]string{"a", "b"}, []int{3, 1})
+
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		addr, err := b.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		counts[addr]++
+	}
+	if counts["a"] != 6 || counts["b"] != 2 {
+		t.Errorf("counts = %v, want a=6 b=2 over 8 picks at weights 3:1", counts)
+	}
+}
+
+func TestFailoverBalancerPrefersFirstHealthy(t *testing.T) {
+	b := NewFailoverBalancer([]string{"primary", "secondary"})
+
+	addr, err := b.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if addr != "primary" {
+		t.Fatalf("Next() = %q, want %q", addr, "primary")
+	}
+
+	b.SetHealthy("primary", false)
+	addr, err = b.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if addr != "secondary" {
+		t.Errorf("Next() after primary down = %q, want %q", addr, "secondary")
+	}
+
+	b.SetHealthy("primary", true)
+	addr, err = b.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if addr != "primary" {
+		t.Errorf("Next() after primary recovers = %q, want %q", addr, "primary")
+	}
+}
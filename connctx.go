@@ -0,0 +1,135 @@
+package tcpint
+
+import (
+	"net"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HandlerFunc processes one logical message read from either leg of a
+// connection and returns the bytes that should be forwarded to the other
+// leg (or nil to drop the message). ctx is shared by both directions of the
+// same connection.
+type HandlerFunc func(ctx *ConnContext, b []byte) []byte
+
+// LegacyHandler adapts a pre-ConnContext handler (func([]byte) []byte) to
+// HandlerFunc, for callers upgrading from the old clienthandler/remotehandler
+// signature without rewriting them.
+func LegacyHandler(fn func([]byte) []byte) HandlerFunc {
+	return func(ctx *ConnContext, b []byte) []byte {
+		return fn(b)
+	}
+}
+
+// ConnContext carries per-connection state into HandlerFuncs: a stable
+// connection id, the client's remote address, a scratch space for
+// stateful handlers, and injectors scoped to this connection only (unlike
+// Proxy.Inject, which is process-global). clienthandler and remotehandler
+// run concurrently on the same ConnContext, so Get/Set/Logger/Inject* are
+// the only safe ways to touch it.
+type ConnContext struct {
+	ID         string
+	RemoteAddr net.Addr
+
+	log          *log.Entry
+	client       *SafeConn
+	remote       *SafeConn
+	done         chan struct{}
+	teardownOnce sync.Once
+
+	sync.Mutex
+	values         map[string]any
+	clientinjector []byte
+	remoteinjector []byte
+}
+
+func newConnContext(p *Proxy, id string, client, remote *SafeConn) *ConnContext {
+	return &ConnContext{
+		ID:         id,
+		RemoteAddr: client.RemoteAddr(),
+		client:     client,
+		remote:     remote,
+		done:       make(chan struct{}),
+		values:     map[string]any{},
+		log:        p.log.WithField("conn", id),
+	}
+}
+
+// teardown closes both legs of this connection, so an error on one side
+// (a real socket error, an idle-deadline expiry, or a failed heartbeat)
+// tears down just this connection instead of the whole Proxy. It also
+// signals Done, so goroutines scoped to this connection (e.g.
+// processinjection) know to stop rather than outliving it.
+func (c *ConnContext) teardown() {
+	c.teardownOnce.Do(func() {
+		c.client.Close()
+		c.remote.Close()
+		close(c.done)
+	})
+}
+
+// Done returns a channel that's closed once this connection has been torn
+// down, for goroutines that need to stop alongside it.
+func (c *ConnContext) Done() <-chan struct{} {
+	return c.done
+}
+
+// Logger returns a logger already tagged with this connection's id.
+func (c *ConnContext) Logger() *log.Entry {
+	return c.log
+}
+
+// Get returns the scratch value stored under key, and whether it was set.
+func (c *ConnContext) Get(key string) (any, bool) {
+	c.Lock()
+	defer c.Unlock()
+	v, ok := c.values[key]
+	return v, ok
+}
+
+// Set stores a scratch value under key, visible to both directions of this
+// connection.
+func (c *ConnContext) Set(key string, value any) {
+	c.Lock()
+	defer c.Unlock()
+	c.values[key] = value
+}
+
+// InjectClient queues b to be written to this connection's client side, as
+// soon as the injection loop next runs.
+func (c *ConnContext) InjectClient(b []byte) {
+	c.inject(&c.clientinjector, b)
+}
+
+// InjectRemote queues b to be written to this connection's remote side.
+func (c *ConnContext) InjectRemote(b []byte) {
+	c.inject(&c.remoteinjector, b)
+}
+
+func (c *ConnContext) inject(slot *[]byte, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	*slot = append(*slot, b...)
+}
+
+// takeInject returns and clears the pending injected bytes for writertype
+// ("client" or "remote"), or nil if there are none.
+func (c *ConnContext) takeInject(writertype string) []byte {
+	c.Lock()
+	defer c.Unlock()
+
+	slot := &c.clientinjector
+	if writertype == "remote" {
+		slot = &c.remoteinjector
+	}
+	if len(*slot) == 0 {
+		return nil
+	}
+	b := *slot
+	*slot = nil
+	return b
+}
@@ -0,0 +1,219 @@
+package tcpint
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Framer turns a byte stream into logical messages. ReadFrame reads exactly
+// one message from r, and WriteFrame writes one message to w, so
+// clienthandler/remotehandler always see whole messages regardless of how
+// the transport happened to chunk them.
+type Framer interface {
+	ReadFrame(r *bufio.Reader) ([]byte, error)
+	WriteFrame(w io.Writer, b []byte) (int, error)
+}
+
+// DelimiterFramer frames messages by a single trailing byte, e.g. the null
+// terminator historically used as Proxy's default.
+type DelimiterFramer struct {
+	Delimiter byte
+}
+
+// NullFramer is the original null-terminated framing.
+var NullFramer = DelimiterFramer{Delimiter: NULLBYTE}
+
+// LineFramer frames messages by a trailing '\n'.
+var LineFramer = DelimiterFramer{Delimiter: '\n'}
+
+func (f DelimiterFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	return r.ReadBytes(f.Delimiter)
+}
+
+func (f DelimiterFramer) WriteFrame(w io.Writer, b []byte) (int, error) {
+	return w.Write(b)
+}
+
+// ByteOrder selects the endianness used by LengthPrefixedFramer.
+type ByteOrder int
+
+const (
+	BigEndian ByteOrder = iota
+	LittleEndian
+)
+
+// LengthPrefixedFramer frames messages with a fixed-width length prefix
+// carrying the payload size. Width must be 2 (uint16) or 4 (uint32); the
+// prefix itself is not included in the payload handed to handlers.
+//
+// MaxFrameSize bounds the payload size read off the wire before it's
+// allocated, so a peer can't force a multi-gigabyte allocation by sending a
+// header claiming a huge length. Zero means defaultMaxFrameSize.
+type LengthPrefixedFramer struct {
+	Width        int
+	Order        ByteOrder
+	MaxFrameSize uint32
+}
+
+// defaultMaxFrameSize caps LengthPrefixedFramer payloads when MaxFrameSize
+// is left at its zero value.
+const defaultMaxFrameSize = 16 * 1024 * 1024 // 16MiB
+
+var (
+	Uint16BEFramer = LengthPrefixedFramer{Width: 2, Order: BigEndian}
+	Uint16LEFramer = LengthPrefixedFramer{Width: 2, Order: LittleEndian}
+	Uint32BEFramer = LengthPrefixedFramer{Width: 4, Order: BigEndian}
+	Uint32LEFramer = LengthPrefixedFramer{Width: 4, Order: LittleEndian}
+)
+
+func (f LengthPrefixedFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, f.Width)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	var n uint32
+	switch f.Width {
+	case 2:
+		if f.Order == BigEndian {
+			n = uint32(binary.BigEndian.Uint16(header))
+		} else {
+			n = uint32(binary.LittleEndian.Uint16(header))
+		}
+	case 4:
+		if f.Order == BigEndian {
+			n = binary.BigEndian.Uint32(header)
+		} else {
+			n = binary.LittleEndian.Uint32(header)
+		}
+	default:
+		return nil, fmt.Errorf("tcpint: unsupported length prefix width %d", f.Width)
+	}
+
+	maxFrameSize := f.MaxFrameSize
+	if maxFrameSize == 0 {
+		maxFrameSize = defaultMaxFrameSize
+	}
+	if n > maxFrameSize {
+		return nil, fmt.Errorf("tcpint: frame size %d exceeds MaxFrameSize %d", n, maxFrameSize)
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func (f LengthPrefixedFramer) WriteFrame(w io.Writer, b []byte) (int, error) {
+	header := make([]byte, f.Width)
+	switch f.Width {
+	case 2:
+		if len(b) > 0xFFFF {
+			return 0, fmt.Errorf("tcpint: frame size %d exceeds max %d for a width-2 length prefix", len(b), 0xFFFF)
+		}
+		if f.Order == BigEndian {
+			binary.BigEndian.PutUint16(header, uint16(len(b)))
+		} else {
+			binary.LittleEndian.PutUint16(header, uint16(len(b)))
+		}
+	case 4:
+		if int64(len(b)) > math.MaxUint32 {
+			return 0, fmt.Errorf("tcpint: frame size %d exceeds max %d for a width-4 length prefix", len(b), uint32(math.MaxUint32))
+		}
+		if f.Order == BigEndian {
+			binary.BigEndian.PutUint32(header, uint32(len(b)))
+		} else {
+			binary.LittleEndian.PutUint32(header, uint32(len(b)))
+		}
+	default:
+		return 0, fmt.Errorf("tcpint: unsupported length prefix width %d", f.Width)
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return 0, err
+	}
+	return w.Write(b)
+}
+
+// FixedSizeFramer frames messages as fixed-size records.
+type FixedSizeFramer struct {
+	Size int
+}
+
+func (f FixedSizeFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	buf := make([]byte, f.Size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (f FixedSizeFramer) WriteFrame(w io.Writer, b []byte) (int, error) {
+	return w.Write(b)
+}
+
+// HTTPFramer frames raw bytes at HTTP/1.1 request/response boundaries,
+// using the Content-Length header to find the end of the body. Chunked
+// transfer-encoding is not supported.
+type HTTPFramer struct{}
+
+func (HTTPFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	contentLength := -1
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(line)
+
+		trimmed := bytes.TrimRight(line, "\r\n")
+		if len(trimmed) == 0 {
+			break // blank line ends the header block
+		}
+		if name, value, ok := bytes.Cut(trimmed, []byte(":")); ok {
+			if bytes.EqualFold(bytes.TrimSpace(name), []byte("Content-Length")) {
+				if n, convErr := strconv.Atoi(string(bytes.TrimSpace(value))); convErr == nil {
+					contentLength = n
+				}
+			}
+		}
+	}
+
+	if contentLength > 0 {
+		body := make([]byte, contentLength)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, err
+		}
+		buf.Write(body)
+	}
+	return buf.Bytes(), nil
+}
+
+func (HTTPFramer) WriteFrame(w io.Writer, b []byte) (int, error) {
+	return w.Write(b)
+}
+
+// RawFramer forwards whatever a single underlying Read returns, for
+// protocols that have no framing that can be detected from the byte stream.
+type RawFramer struct{}
+
+func (RawFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	buf := make([]byte, 4096)
+	n, err := r.Read(buf)
+	if n > 0 {
+		return buf[:n], nil
+	}
+	return nil, err
+}
+
+func (RawFramer) WriteFrame(w io.Writer, b []byte) (int, error) {
+	return w.Write(b)
+}
@@ -0,0 +1,108 @@
+package tcpint
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestDelimiterFramerRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NullFramer.WriteFrame(&buf, []byte("hello")); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	buf.WriteByte(NULLBYTE)
+
+	got, err := NullFramer.ReadFrame(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if string(got) != "hello\x00" {
+		t.Errorf("ReadFrame = %q, want %q", got, "hello\x00")
+	}
+}
+
+func TestLengthPrefixedFramerRoundTrip(t *testing.T) {
+	cases := []LengthPrefixedFramer{
+		Uint16BEFramer,
+		Uint16LEFramer,
+		Uint32BEFramer,
+		Uint32LEFramer,
+	}
+	for _, f := range cases {
+		var buf bytes.Buffer
+		payload := []byte("round trip payload")
+		if _, err := f.WriteFrame(&buf, payload); err != nil {
+			t.Fatalf("WriteFrame: %v", err)
+		}
+		got, err := f.ReadFrame(bufio.NewReader(&buf))
+		if err != nil {
+			t.Fatalf("ReadFrame: %v", err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("width %d order %v: ReadFrame = %q, want %q", f.Width, f.Order, got, payload)
+		}
+	}
+}
+
+func TestLengthPrefixedFramerRejectsOversizedFrame(t *testing.T) {
+	f := LengthPrefixedFramer{Width: 4, Order: BigEndian, MaxFrameSize: 8}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteFrame(&buf, make([]byte, 9)); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if _, err := f.ReadFrame(bufio.NewReader(&buf)); err == nil {
+		t.Error("ReadFrame did not reject a frame above MaxFrameSize")
+	}
+}
+
+func TestLengthPrefixedFramerWriteFrameRejectsTruncation(t *testing.T) {
+	f := LengthPrefixedFramer{Width: 2, Order: BigEndian}
+
+	if _, err := f.WriteFrame(&bytes.Buffer{}, make([]byte, 1<<16)); err == nil {
+		t.Error("WriteFrame did not reject a payload that would truncate a width-2 length prefix")
+	}
+}
+
+func TestFixedSizeFramerRoundTrip(t *testing.T) {
+	f := FixedSizeFramer{Size: 4}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteFrame(&buf, []byte("abcd")); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	got, err := f.ReadFrame(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if string(got) != "abcd" {
+		t.Errorf("ReadFrame = %q, want %q", got, "abcd")
+	}
+}
+
+func TestHTTPFramerReadsHeaderAndBody(t *testing.T) {
+	raw := "POST /x HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nhello"
+	buf := bytes.NewBufferString(raw)
+
+	got, err := (HTTPFramer{}).ReadFrame(bufio.NewReader(buf))
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if string(got) != raw {
+		t.Errorf("ReadFrame = %q, want %q", got, raw)
+	}
+}
+
+func TestHTTPFramerReadsHeaderOnlyWhenNoBody(t *testing.T) {
+	raw := "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	buf := bytes.NewBufferString(raw)
+
+	got, err := (HTTPFramer{}).ReadFrame(bufio.NewReader(buf))
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if string(got) != raw {
+		t.Errorf("ReadFrame = %q, want %q", got, raw)
+	}
+}
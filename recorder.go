@@ -0,0 +1,153 @@
+package tcpint
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// RecordedFrame is one intercepted message, captured as it passed through a
+// Proxy's Framer. Pre is exactly what ReadFrame returned; Post is what the
+// handler produced and actually got forwarded (nil if the handler dropped
+// the message).
+type RecordedFrame struct {
+	ConnID    string    `json:"conn_id"`
+	Direction string    `json:"direction"` // "client" or "remote", matches intercept's readertype
+	Timestamp time.Time `json:"timestamp"`
+	Pre       []byte    `json:"pre"`
+	Post      []byte    `json:"post"`
+}
+
+// Recorder persists RecordedFrames for later inspection or Replayer use. Set
+// Proxy.Recorder to have every intercepted frame passed to Record (frames
+// swallowed by HeartbeatDetector are not).
+type Recorder interface {
+	Record(f RecordedFrame) error
+	Close() error
+}
+
+// JSONLRecorder writes one JSON object per frame, one per line.
+type JSONLRecorder struct {
+	w   io.WriteCloser
+	enc *json.Encoder
+
+	sync.Mutex
+}
+
+// NewJSONLRecorder creates (or truncates) path and returns a Recorder that
+// appends one JSON-encoded RecordedFrame per line to it.
+func NewJSONLRecorder(path string) (*JSONLRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLRecorder{w: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (r *JSONLRecorder) Record(f RecordedFrame) error {
+	r.Lock()
+	defer r.Unlock()
+	return r.enc.Encode(f)
+}
+
+func (r *JSONLRecorder) Close() error {
+	return r.w.Close()
+}
+
+// PcapRecorder writes frames as synthetic loopback IPv4/TCP packets so
+// existing pcap tooling (Wireshark, tcpdump -r) can inspect an intercepted
+// session. Client and remote directions are given distinct, fixed port
+// numbers so a single connection's two legs show up as one TCP stream.
+type PcapRecorder struct {
+	w   *pcapgo.Writer
+	f   io.WriteCloser
+	seq map[string]uint32 // keyed "connid/direction"
+
+	sync.Mutex
+}
+
+const (
+	pcapClientPort layers.TCPPort = 40000
+	pcapRemotePort layers.TCPPort = 40001
+)
+
+// NewPcapRecorder creates (or truncates) path and returns a Recorder that
+// writes frames to it in pcap format.
+func NewPcapRecorder(path string) (*PcapRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &PcapRecorder{w: w, f: f, seq: map[string]uint32{}}, nil
+}
+
+func (r *PcapRecorder) Record(f RecordedFrame) error {
+	r.Lock()
+	defer r.Unlock()
+
+	payload := f.Post
+	if len(payload) == 0 {
+		payload = f.Pre
+	}
+
+	srcPort, dstPort := pcapClientPort, pcapRemotePort
+	if f.Direction == "remote" {
+		srcPort, dstPort = dstPort, srcPort
+	}
+
+	eth := &layers.Ethernet{EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.IPv4(127, 0, 0, 1),
+		DstIP:    net.IPv4(127, 0, 0, 1),
+	}
+	tcp := &layers.TCP{
+		SrcPort: srcPort,
+		DstPort: dstPort,
+		PSH:     true,
+		ACK:     true,
+		Seq:     r.nextSeq(f.ConnID, f.Direction, uint32(len(payload))),
+	}
+	if err := tcp.SetNetworkLayerForChecksum(ip); err != nil {
+		return err
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, tcp, gopacket.Payload(payload)); err != nil {
+		return err
+	}
+
+	return r.w.WritePacket(gopacket.CaptureInfo{
+		Timestamp:     f.Timestamp,
+		CaptureLength: len(buf.Bytes()),
+		Length:        len(buf.Bytes()),
+	}, buf.Bytes())
+}
+
+// nextSeq returns the next TCP sequence number for a connection/direction
+// pair and advances it by n, so replayed captures show a contiguous stream.
+func (r *PcapRecorder) nextSeq(connID, direction string, n uint32) uint32 {
+	key := connID + "/" + direction
+	seq := r.seq[key]
+	r.seq[key] = seq + n
+	return seq
+}
+
+func (r *PcapRecorder) Close() error {
+	return r.f.Close()
+}
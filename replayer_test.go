@@ -0,0 +1,69 @@
+package tcpint
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReplayerClientOnly(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn) // echo upstream
+	}()
+
+	var mu sync.Mutex
+	var seen []byte
+	echo := func(ctx *ConnContext, b []byte) []byte {
+		mu.Lock()
+		seen = append(seen, b...)
+		mu.Unlock()
+		return b
+	}
+
+	passthrough := func(ctx *ConnContext, b []byte) []byte { return b }
+
+	p := NewProxy("", ln.Addr().String(), echo, passthrough, NullFramer)
+
+	recPath := filepath.Join(t.TempDir(), "session.jsonl")
+	rec, err := NewJSONLRecorder(recPath)
+	if err != nil {
+		t.Fatalf("NewJSONLRecorder: %v", err)
+	}
+	want := []byte("hello\x00")
+	if err := rec.Record(RecordedFrame{ConnID: "1", Direction: "client", Timestamp: time.Now(), Pre: want}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	replayer, err := NewReplayerFromJSONL(recPath)
+	if err != nil {
+		t.Fatalf("NewReplayerFromJSONL: %v", err)
+	}
+
+	if err := replayer.Replay(p, ReplayClientOnly); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !bytes.Equal(seen, want) {
+		t.Errorf("clienthandler saw %q, want %q", seen, want)
+	}
+}
@@ -2,8 +2,12 @@ package tcpint
 
 import (
 	"bufio"
+	"crypto/tls"
+	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -17,9 +21,45 @@ type Proxy struct {
 	to            string
 	done          chan struct{}
 	log           *log.Entry
-	clienthandler func([]byte) []byte
-	remotehandler func([]byte) []byte
-	delimeter     byte
+	clienthandler HandlerFunc
+	remotehandler HandlerFunc
+	framer        Framer
+
+	// TLS termination/pass-through, set via NewTLSProxy
+	listenerTLSConfig *tls.Config
+	dialerTLSConfig   *tls.Config
+
+	// WebSocket carrier transport, set via NewWSListenerProxy/NewWSDialerProxy
+	wsListen  bool
+	wsDialURL string
+
+	// Upstream pool, set via NewProxyPool/SetBalancer. When balancer is
+	// nil, `to` is dialed directly as before.
+	tos      []string
+	balancer Balancer
+
+	// Heartbeat/keepalive, set directly on Proxy after construction.
+	// HeartbeatInterval, if non-zero, periodically writes HeartbeatPayload
+	// to the remote side. HeartbeatDetector, if set, identifies heartbeat
+	// replies coming back so they're swallowed instead of forwarded to the
+	// client. HeartbeatTimeout, if non-zero, also bounds how long either
+	// side may stay silent before the connection is torn down.
+	HeartbeatInterval time.Duration
+	HeartbeatTimeout  time.Duration
+	HeartbeatPayload  []byte
+	HeartbeatDetector func([]byte) bool
+
+	// ReadIdleTimeout/WriteIdleTimeout, if non-zero, bound how long a read
+	// or write may block before handle() is torn down, instead of blocking
+	// forever in r.ReadBytes on a half-open socket.
+	ReadIdleTimeout  time.Duration
+	WriteIdleTimeout time.Duration
+
+	// Recorder, if set, receives every intercepted frame for offline
+	// inspection or later Replayer use. Frames swallowed by
+	// HeartbeatDetector are not recorded.
+	Recorder    Recorder
+	connCounter uint64
 
 	// dynamic fields
 	clientinjector []byte
@@ -34,7 +74,7 @@ type SafeConn struct {
 	sync.Mutex
 }
 
-func NewProxy(from, to string, clienthandler, remotehandler func([]byte) []byte, delimeter byte) *Proxy {
+func NewProxy(from, to string, clienthandler, remotehandler HandlerFunc, framer Framer) *Proxy {
 	return &Proxy{
 		from: from,
 		to:   to,
@@ -47,7 +87,7 @@ func NewProxy(from, to string, clienthandler, remotehandler func([]byte) []byte,
 		remotehandler:  remotehandler,
 		clientinjector: []byte{},
 		remoteinjector: []byte{},
-		delimeter:      delimeter,
+		framer:         framer,
 	}
 }
 
@@ -96,7 +136,18 @@ func (p *Proxy) ClearInject(writertype string) {
 // Start proxy server
 func (p *Proxy) Start() error {
 	p.log.Infoln("Starting proxy on", p.from)
-	listener, err := net.Listen("tcp", p.from)
+
+	if p.wsListen {
+		return p.startWSListener()
+	}
+
+	var listener net.Listener
+	var err error
+	if p.listenerTLSConfig != nil {
+		listener, err = tls.Listen("tcp", p.from, p.listenerTLSConfig)
+	} else {
+		listener, err = net.Listen("tcp", p.from)
+	}
 	if err != nil {
 		return err
 	}
@@ -138,76 +189,220 @@ func (p *Proxy) handle(connection net.Conn) {
 	p.log.Debugln("Handling", connection)
 	defer p.log.Debugln("Done handling", connection)
 	defer connection.Close()
-	// Connect to remote server
-	remote, err := net.Dial("tcp", p.to)
+	// Connect to remote server, trying the next healthy upstream on failure
+	remote, target, err := p.dial()
 	if err != nil {
 		p.log.WithField("err", err).Errorln("Error dialing remote host")
 		return
 	}
 	defer remote.Close()
+	if p.balancer != nil {
+		defer p.balancer.Release(target)
+	}
+	p.HandleConn(connection, remote)
+}
+
+// HandleConn runs the intercept/inject pipeline over an already-established
+// client and remote connection, bypassing the dial step. handle() is the
+// normal entry point; Replayer calls HandleConn directly with net.Pipe()
+// ends so handler functions can be regression-tested without a live dial.
+func (p *Proxy) HandleConn(connection, remote net.Conn) {
 	// Wrap net.Conn in SafeConn to provide mutex support
 	safeconnection := NewSafeConn(connection)
 	saferemote := NewSafeConn(remote)
+	connID := fmt.Sprintf("%d", atomic.AddUint64(&p.connCounter, 1))
+	ctx := newConnContext(p, connID, safeconnection, saferemote)
 	// Create a new waitgroup
 	wg := &sync.WaitGroup{}
 	wg.Add(2)
 	// Pushing data from client to remote host
-	go p.intercept(safeconnection, saferemote, "client", "remote", wg)
+	go p.intercept(safeconnection, saferemote, "client", "remote", ctx, wg)
 	// Pushing data to client from remote host
-	go p.intercept(saferemote, safeconnection, "remote", "client", wg)
+	go p.intercept(saferemote, safeconnection, "remote", "client", ctx, wg)
+	// Keep the remote side alive and detect half-open sockets
+	if p.HeartbeatInterval > 0 {
+		go p.heartbeat(ctx, saferemote)
+	}
 	wg.Wait()
 }
 
-func (p *Proxy) processinjection(to *SafeConn, writertype string) {
-	select {
-	case <-p.done:
-		return
+// heartbeat periodically writes HeartbeatPayload to `to` until the
+// connection (or proxy) stops. HeartbeatDetector on the reading side is
+// responsible for swallowing the corresponding replies. A failed write
+// tears down just this connection, not the whole Proxy.
+func (p *Proxy) heartbeat(ctx *ConnContext, to *SafeConn) {
+	ticker := time.NewTicker(p.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			to.Lock()
+			_, err := p.framer.WriteFrame(to, p.HeartbeatPayload)
+			to.Unlock()
+			if err != nil {
+				p.log.WithField("err", err).Errorln("Error writing heartbeat")
+				ctx.teardown()
+				return
+			}
+		}
+	}
+}
+
+// maxDialAttempts bounds how many upstreams a single connection will try
+// via the balancer before giving up.
+const maxDialAttempts = 3
+
+// dial picks a target (via the balancer, if one is set) and connects to it,
+// falling back to the next healthy upstream on failure. It returns the
+// target actually connected to, so callers can later Release it.
+func (p *Proxy) dial() (net.Conn, string, error) {
+	if p.balancer == nil {
+		conn, err := p.dialTarget(p.to)
+		return conn, p.to, err
+	}
+
+	var lastErr error
+	for i := 0; i < maxDialAttempts; i++ {
+		target, err := p.balancer.Next()
+		if err != nil {
+			return nil, "", err
+		}
+		conn, err := p.dialTarget(target)
+		if err == nil {
+			return conn, target, nil
+		}
+		p.log.WithField("err", err).WithField("upstream", target).Warnln("Error dialing upstream, marking unhealthy")
+		p.balancer.SetHealthy(target, false)
+		p.balancer.Release(target)
+		lastErr = err
+	}
+	return nil, "", lastErr
+}
+
+func (p *Proxy) dialTarget(target string) (net.Conn, error) {
+	switch {
+	case p.wsDialURL != "":
+		return dialWS(p.wsDialURL)
+	case p.dialerTLSConfig != nil:
+		return tls.Dial("tcp", target, p.dialerTLSConfig)
 	default:
-		for {
-			var err error
-			var injector []byte
-
-			// Get injected bytes
-			p.Lock()
-			switch writertype {
-			case "remote":
-				injector = p.remoteinjector
-			default: // "client"
-				injector = p.clientinjector
+		return net.Dial("tcp", target)
+	}
+}
+
+// NewProxyPool builds a Proxy that load-balances across tos using a
+// round-robin Balancer, with a background TCP-connect health check keeping
+// upstream health up to date. Use SetBalancer afterwards to swap in a
+// different strategy (random, least-connections, weighted, failover).
+func NewProxyPool(from string, tos []string, clienthandler, remotehandler HandlerFunc, framer Framer) *Proxy {
+	p := NewProxy(from, "", clienthandler, remotehandler, framer)
+	p.tos = tos
+	p.balancer = NewRoundRobinBalancer(tos)
+	p.StartHealthChecks(5*time.Second, TCPHealthCheck(2*time.Second))
+	return p
+}
+
+// SetBalancer replaces the proxy's upstream balancer, e.g. to switch a pool
+// built with NewProxyPool from round-robin to a different strategy.
+func (p *Proxy) SetBalancer(b Balancer) {
+	p.balancer = b
+}
+
+// injectionPollInterval bounds how often processinjection wakes up to check
+// for pending injected bytes when there's nothing to do, so an idle
+// connection's injection loop blocks instead of spinning.
+const injectionPollInterval = 50 * time.Millisecond
+
+func (p *Proxy) processinjection(ctx *ConnContext, to *SafeConn, writertype string) {
+	ticker := time.NewTicker(injectionPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Global, process-wide inject (Proxy.Inject/ClearInject)
+		var globalinjector []byte
+		p.Lock()
+		switch writertype {
+		case "remote":
+			globalinjector = p.remoteinjector
+		default: // "client"
+			globalinjector = p.clientinjector
+		}
+		p.Unlock()
+
+		if len(globalinjector) > 0 {
+			injectbuf := make([]byte, len(globalinjector))
+			_ = copy(injectbuf, globalinjector)
+			p.ClearInject(writertype)
+			if !p.writeInjected(ctx, to, injectbuf) {
+				return
 			}
-			p.Unlock()
-
-			if len(injector) > 0 {
-				// Read injected bytes
-				p.log.WithField("data", injector).Infoln("Found injected bytes")
-				injectbuf := make([]byte, len(injector))
-				_ = copy(injectbuf, injector)
-				p.ClearInject(writertype)
-
-				// Write injected bytes
-				to.Lock()
-				p.log.WithField("data", injectbuf).Infoln("Writing injected bytes")
-				_, err = to.Write(injectbuf)
-				if err != nil {
-					to.Unlock()
-					p.log.WithField("err", err).Errorln("Error writing injected bytes")
-					p.Stop()
-					return
-				}
-				to.Unlock()
+		}
+
+		// Per-connection inject, scoped via ctx.InjectClient/InjectRemote
+		if injectbuf := ctx.takeInject(writertype); len(injectbuf) > 0 {
+			if !p.writeInjected(ctx, to, injectbuf) {
+				return
 			}
 		}
 	}
 }
 
-// fn func([]byte) []byte, injector []byte
-func (p *Proxy) intercept(from, to *SafeConn, readertype string, writertype string, wg *sync.WaitGroup) {
+// writeInjected writes injectbuf to `to` through the framer, tearing down
+// just this connection (not the whole Proxy) and reporting false on error.
+func (p *Proxy) writeInjected(ctx *ConnContext, to *SafeConn, injectbuf []byte) bool {
+	ctx.log.WithField("data", injectbuf).Infoln("Writing injected bytes")
+	to.Lock()
+	defer to.Unlock()
+	if _, err := p.framer.WriteFrame(to, injectbuf); err != nil {
+		p.log.WithField("err", err).Errorln("Error writing injected bytes")
+		ctx.teardown()
+		return false
+	}
+	return true
+}
+
+// readDeadline returns the tightest deadline that should be applied to the
+// next read, derived from ReadIdleTimeout and HeartbeatTimeout, or the zero
+// Time if neither is configured.
+func (p *Proxy) readDeadline() time.Time {
+	var timeout time.Duration
+	switch {
+	case p.ReadIdleTimeout > 0 && p.HeartbeatTimeout > 0:
+		timeout = p.ReadIdleTimeout
+		if p.HeartbeatTimeout < timeout {
+			timeout = p.HeartbeatTimeout
+		}
+	case p.ReadIdleTimeout > 0:
+		timeout = p.ReadIdleTimeout
+	case p.HeartbeatTimeout > 0:
+		timeout = p.HeartbeatTimeout
+	default:
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// fn HandlerFunc, injector []byte
+func (p *Proxy) intercept(from, to *SafeConn, readertype string, writertype string, ctx *ConnContext, wg *sync.WaitGroup) {
 	defer wg.Done()
 	// Create reader
 	r := bufio.NewReader(from)
 
 	// Set parameters
-	var fn func([]byte) []byte
+	var fn HandlerFunc
 	switch readertype {
 	case "remote":
 		fn = p.remotehandler
@@ -216,7 +411,7 @@ func (p *Proxy) intercept(from, to *SafeConn, readertype string, writertype stri
 	}
 
 	// Start injection loop
-	go p.processinjection(to, writertype)
+	go p.processinjection(ctx, to, writertype)
 
 	select {
 	// If our proxy is stopped, return
@@ -227,26 +422,61 @@ func (p *Proxy) intercept(from, to *SafeConn, readertype string, writertype stri
 			var buf []byte
 			var err error
 
-			// Read bytes up to delimeter
-			buf, err = r.ReadBytes(p.delimeter)
+			// Bound the read so a half-open socket can't block forever
+			if deadline := p.readDeadline(); !deadline.IsZero() {
+				if err = from.SetReadDeadline(deadline); err != nil {
+					p.log.WithField("err", err).Errorln("Error setting read deadline")
+					ctx.teardown()
+					return
+				}
+			}
+
+			// Read a whole logical message, however the framer defines one
+			buf, err = p.framer.ReadFrame(r)
 			if err != nil {
 				p.log.WithField("err", err).Errorln("Error from reader")
-				p.Stop()
+				ctx.teardown()
 				return
 			}
 
+			// Swallow heartbeat replies rather than forwarding them to the peer
+			if p.HeartbeatDetector != nil && p.HeartbeatDetector(buf) {
+				p.log.Debugln("Swallowed heartbeat")
+				continue
+			}
+
 			// Run process function
 			to.Lock()
 
-			modbuf := fn(buf)
+			modbuf := fn(ctx, buf)
+
+			if p.Recorder != nil {
+				if recErr := p.Recorder.Record(RecordedFrame{
+					ConnID:    ctx.ID,
+					Direction: readertype,
+					Timestamp: time.Now(),
+					Pre:       buf,
+					Post:      modbuf,
+				}); recErr != nil {
+					p.log.WithField("err", recErr).Errorln("Error recording frame")
+				}
+			}
 
 			if len(modbuf) > 0 {
+				if p.WriteIdleTimeout > 0 {
+					if err = to.SetWriteDeadline(time.Now().Add(p.WriteIdleTimeout)); err != nil {
+						to.Unlock()
+						p.log.WithField("err", err).Errorln("Error setting write deadline")
+						ctx.teardown()
+						return
+					}
+				}
 				// Write bytes to other side
-				_, err = to.Write(modbuf)
+				_, err = p.framer.WriteFrame(to, modbuf)
 				if err != nil {
 					to.Unlock()
 					p.log.WithField("err", err).Errorln("Error writing")
-					p.Stop()
+					ctx.teardown()
 					return
 				}
 			}
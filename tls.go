@@ -0,0 +1,87 @@
+package tcpint
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig describes the TLS behaviour of a Proxy on either leg.
+// Leave ListenCert/ListenKey empty to keep the client-facing listener
+// plaintext, and leave DialTLS false to keep the upstream dial plaintext.
+type TLSConfig struct {
+	// Client-facing listener (TLS termination)
+	ListenCert string // PEM cert presented to clients
+	ListenKey  string // PEM key matching ListenCert
+	ClientCAs  string // PEM bundle of CAs trusted for client certs (enables mTLS)
+
+	// Upstream-facing dialer (TLS pass-through)
+	DialTLS            bool
+	UpstreamServerName string
+	UpstreamCAs        string // PEM bundle to verify the upstream; system pool if empty
+	InsecureSkipVerify bool
+
+	ALPN []string
+}
+
+// NewTLSProxy builds a Proxy with TLS termination on the listener side
+// and/or TLS pass-through on the dialer side, as configured in cfg.
+// clienthandler/remotehandler see decrypted bytes in both cases.
+func NewTLSProxy(from, to string, clienthandler, remotehandler HandlerFunc, framer Framer, cfg *TLSConfig) (*Proxy, error) {
+	p := NewProxy(from, to, clienthandler, remotehandler, framer)
+
+	if cfg == nil {
+		return p, nil
+	}
+
+	if cfg.ListenCert != "" || cfg.ListenKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ListenCert, cfg.ListenKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading listener cert/key: %w", err)
+		}
+		listenerTLSConfig := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   cfg.ALPN,
+		}
+		if cfg.ClientCAs != "" {
+			pool, err := loadCAPool(cfg.ClientCAs)
+			if err != nil {
+				return nil, fmt.Errorf("loading client CA bundle: %w", err)
+			}
+			listenerTLSConfig.ClientCAs = pool
+			listenerTLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		p.listenerTLSConfig = listenerTLSConfig
+	}
+
+	if cfg.DialTLS {
+		dialerTLSConfig := &tls.Config{
+			ServerName:         cfg.UpstreamServerName,
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+			NextProtos:         cfg.ALPN,
+		}
+		if cfg.UpstreamCAs != "" {
+			pool, err := loadCAPool(cfg.UpstreamCAs)
+			if err != nil {
+				return nil, fmt.Errorf("loading upstream CA bundle: %w", err)
+			}
+			dialerTLSConfig.RootCAs = pool
+		}
+		p.dialerTLSConfig = dialerTLSConfig
+	}
+
+	return p, nil
+}
+
+func loadCAPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,113 @@
+package tcpint
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// NewWSListenerProxy builds a Proxy whose client-facing leg is a WebSocket
+// upgrade rather than raw TCP: from is the HTTP listen address, and incoming
+// binary frames are treated as the byte stream handed to clienthandler.
+func NewWSListenerProxy(from, to string, clienthandler, remotehandler HandlerFunc, framer Framer) *Proxy {
+	p := NewProxy(from, to, clienthandler, remotehandler, framer)
+	p.wsListen = true
+	return p
+}
+
+// NewWSDialerProxy builds a Proxy whose upstream leg dials a wss:// (or ws://)
+// origin instead of a raw TCP host: to is the WebSocket URL, and the proxy
+// tunnels bytes to/from it as binary frames.
+func NewWSDialerProxy(from, to string, clienthandler, remotehandler HandlerFunc, framer Framer) *Proxy {
+	p := NewProxy(from, to, clienthandler, remotehandler, framer)
+	p.wsDialURL = to
+	return p
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// startWSListener runs an HTTP server on p.from that upgrades every request
+// to a WebSocket and feeds the resulting conn into the normal handle() path.
+func (p *Proxy) startWSListener() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		wsconn, err := wsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			p.log.WithField("err", err).Errorln("Error upgrading websocket")
+			return
+		}
+		p.log.Infoln("New connection")
+		go p.handle(newWSConn(wsconn))
+	})
+
+	server := &http.Server{
+		Addr:    p.from,
+		Handler: mux,
+	}
+
+	listener, err := net.Listen("tcp", p.from)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-p.done
+		server.Close()
+	}()
+	go server.Serve(listener)
+	return nil
+}
+
+func dialWS(rawurl string) (net.Conn, error) {
+	wsconn, _, err := websocket.DefaultDialer.Dial(rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newWSConn(wsconn), nil
+}
+
+// wsConn adapts a *websocket.Conn to net.Conn so it can flow through the
+// existing SafeConn/bufio.Reader machinery unchanged: binary frames become
+// the byte stream, and partial reads are buffered across frame boundaries.
+type wsConn struct {
+	*websocket.Conn
+
+	leftover []byte
+}
+
+func newWSConn(conn *websocket.Conn) *wsConn {
+	return &wsConn{Conn: conn}
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for len(c.leftover) == 0 {
+		_, msg, err := c.Conn.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.leftover = msg
+	}
+	n := copy(b, c.leftover)
+	c.leftover = c.leftover[n:]
+	return n, nil
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := c.Conn.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.Conn.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.Conn.SetWriteDeadline(t)
+}